@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/floodryan/inclementpatch/tools/poryscript/parser"
+)
+
+var (
+	fontsImportTTFPath   string
+	fontsImportSize      float64
+	fontsImportCharset   string
+	fontsImportOut       string
+	fontsImportFontID    string
+	fontsImportSpacing   int
+	fontsImportRoundMode string
+)
+
+// NewFontsCmd builds the parent `fonts` command.
+func NewFontsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fonts",
+		Short: "Tools for managing font width configs",
+	}
+	cmd.AddCommand(newFontsImportCmd())
+	return cmd
+}
+
+// newFontsImportCmd builds the `fonts import` subcommand, which rasterizes a
+// TrueType/OpenType font and merges the measured glyph widths into an
+// existing font width config.
+func newFontsImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import glyph widths from a TrueType/OpenType font",
+		RunE:  runFontsImport,
+	}
+
+	cmd.Flags().StringVar(&fontsImportTTFPath, "ttf", "", "path to the TrueType/OpenType font file (required)")
+	cmd.Flags().Float64Var(&fontsImportSize, "size", 16, "pixel size to rasterize glyphs at")
+	cmd.Flags().StringVar(&fontsImportCharset, "charset", "", "string containing every codepoint to measure (required)")
+	cmd.Flags().StringVar(&fontsImportOut, "out", "fonts.json", "font config file to merge the imported widths into (created if it doesn't exist)")
+	cmd.Flags().StringVar(&fontsImportFontID, "font-id", "", "fontID to populate in the config (required)")
+	cmd.Flags().IntVar(&fontsImportSpacing, "letter-spacing", 0, "extra pixels to add to every glyph's advance width")
+	cmd.Flags().StringVar(&fontsImportRoundMode, "round", "nearest", "how to round fractional advances to whole pixels: nearest, up, or down")
+	cmd.MarkFlagRequired("ttf")
+	cmd.MarkFlagRequired("charset")
+	cmd.MarkFlagRequired("font-id")
+
+	return cmd
+}
+
+func runFontsImport(cmd *cobra.Command, args []string) error {
+	round, err := parseRoundMode(fontsImportRoundMode)
+	if err != nil {
+		return err
+	}
+
+	charset := []rune(fontsImportCharset)
+	sort.Slice(charset, func(i, j int) bool { return charset[i] < charset[j] })
+
+	imported, err := parser.ImportFontFromTTF(fontsImportTTFPath, parser.ImportOptions{
+		PixelSize:     fontsImportSize,
+		Charset:       charset,
+		Round:         round,
+		LetterSpacing: fontsImportSpacing,
+	})
+	if err != nil {
+		return err
+	}
+
+	config, err := parser.LoadFontConfig(fontsImportOut)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to load font config '%s': %s", fontsImportOut, err)
+	}
+	if config.Fonts == nil {
+		config.Fonts = map[string]parser.Fonts{}
+	}
+	config.Fonts[fontsImportFontID] = parser.MergeFonts(config.Fonts[fontsImportFontID], imported)
+
+	if err := parser.SaveFontConfig(fontsImportOut, config); err != nil {
+		return fmt.Errorf("failed to write font config '%s': %s", fontsImportOut, err)
+	}
+
+	fmt.Printf("Imported %d glyph widths for fontID '%s' into '%s'\n", len(imported.Widths), fontsImportFontID, fontsImportOut)
+	return nil
+}
+
+func parseRoundMode(s string) (parser.RoundMode, error) {
+	switch s {
+	case "nearest":
+		return parser.RoundNearest, nil
+	case "up":
+		return parser.RoundUp, nil
+	case "down":
+		return parser.RoundDown, nil
+	default:
+		return 0, fmt.Errorf("unknown --round mode '%s'; must be one of nearest, up, down", s)
+	}
+}
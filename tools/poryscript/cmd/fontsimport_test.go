@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/floodryan/inclementpatch/tools/poryscript/parser"
+)
+
+func TestParseRoundMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    parser.RoundMode
+		wantErr bool
+	}{
+		{"nearest", parser.RoundNearest, false},
+		{"up", parser.RoundUp, false},
+		{"down", parser.RoundDown, false},
+		{"sideways", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRoundMode(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRoundMode(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRoundMode(%q) returned unexpected error: %s", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRoundMode(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+// NewRootCmd builds the root `inclementpatch` command and wires in its
+// subcommands.
+func NewRootCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inclementpatch",
+		Short: "Tools for working with inclementpatch scripts and assets",
+	}
+	cmd.AddCommand(NewFontsCmd())
+	return cmd
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity classifies how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityWarning flags a problem that FormatTextDiag could still
+	// recover from, such as an unknown control code.
+	SeverityWarning Severity = iota
+	// SeverityError flags malformed input, such as an unmatched '{'.
+	SeverityError
+)
+
+// Diagnostic reports a single issue found while formatting text, along with
+// the byte offset and length of the offending span in the original input,
+// so that editor/LSP-style callers can highlight it without re-scanning.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	Offset   int
+	Length   int
+}
+
+// FormatTextDiag is like FormatText, but instead of stopping at the first
+// problem it keeps formatting on a best-effort basis and collects every
+// issue it finds as a Diagnostic. Issues reported include unknown control
+// codes (checked against Fonts[fontID].Widths, Substitutions, and
+// KnownControlCodes), unmatched '{'/'}', a single word that overflows
+// maxWidth on its own, and lines that exceed Fonts[fontID].MaxLineLength
+// even after wrapping. This is a prerequisite for building a
+// poryscript-style linter around this package.
+func (fc *FontConfig) FormatTextDiag(text string, maxWidth int, fontID string) (string, []Diagnostic, error) {
+	if !fc.isFontIDValid(fontID) && len(fontID) > 0 && fontID != testFontID {
+		validFontIDs := make([]string, len(fc.Fonts))
+		i := 0
+		for k := range fc.Fonts {
+			validFontIDs[i] = k
+			i++
+		}
+		return "", nil, fmt.Errorf("unknown fontID '%s' used in format(). List of valid fontIDs are '%s'", fontID, validFontIDs)
+	}
+
+	tokens, diags := tokenizeText(text)
+	maxLineLength := fc.Fonts[fontID].MaxLineLength
+
+	var formattedSb strings.Builder
+	var curLineSb strings.Builder
+	curWidth := 0
+	isFirstLine := true
+	isFirstWord := true
+	lineStarted := false
+	lineStartOffset := 0
+	lineEndOffset := 0
+
+	var segSb strings.Builder
+	segWidth := 0
+	haveSeg := false
+	segStartOffset := 0
+	segEndOffset := 0
+
+	markLineSpan := func(offset int) {
+		if !lineStarted {
+			lineStartOffset = offset
+			lineStarted = true
+		}
+	}
+
+	checkLineLength := func() {
+		if maxLineLength <= 0 || !lineStarted {
+			return
+		}
+		length := len([]rune(curLineSb.String()))
+		if length > maxLineLength {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("line is %d characters long, which exceeds the configured max of %d for font '%s'", length, maxLineLength, fontID),
+				Offset:   lineStartOffset,
+				Length:   lineEndOffset - lineStartOffset,
+			})
+		}
+	}
+
+	appendWord := func(word string, width int, offset int, length int) {
+		if width > maxWidth {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("word '%s' is %d pixels wide, which overflows the max line width of %d on its own", word, width, maxWidth),
+				Offset:   offset,
+				Length:   length,
+			})
+		}
+		if curWidth+width > maxWidth && curLineSb.Len() > 0 {
+			checkLineLength()
+			formattedSb.WriteString(curLineSb.String())
+			if isFirstLine {
+				formattedSb.WriteString(`\n`)
+				isFirstLine = false
+			} else {
+				formattedSb.WriteString(`\l`)
+			}
+			formattedSb.WriteByte('\n')
+			curLineSb.Reset()
+			lineStarted = false
+			curLineSb.WriteString(word)
+			curWidth = width
+		} else {
+			curWidth += width
+			if !isFirstWord {
+				curLineSb.WriteByte(' ')
+			}
+			curLineSb.WriteString(word)
+		}
+		isFirstWord = false
+		markLineSpan(offset)
+		lineEndOffset = offset + length
+	}
+
+	flushSeg := func() {
+		if !haveSeg {
+			return
+		}
+		if segWidth > maxWidth {
+			diags = append(diags, Diagnostic{
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("word '%s' is %d pixels wide, which overflows the max line width of %d on its own", segSb.String(), segWidth, maxWidth),
+				Offset:   segStartOffset,
+				Length:   segEndOffset - segStartOffset,
+			})
+		}
+		width := segWidth
+		if !isFirstWord {
+			width += fc.getRunePixelWidth(' ', fontID)
+		}
+		appendWord(segSb.String(), width, segStartOffset, segEndOffset-segStartOffset)
+		segSb.Reset()
+		segWidth = 0
+		haveSeg = false
+	}
+
+	for _, tok := range tokens {
+		switch tok.Type {
+		case Space:
+			flushSeg()
+		case LineBreak, ScrollBreak, ParagraphBreak:
+			flushSeg()
+			checkLineLength()
+			curWidth = 0
+			formattedSb.WriteString(curLineSb.String())
+			formattedSb.WriteString(tok.Text)
+			formattedSb.WriteByte('\n')
+			isFirstLine = tok.Type == ParagraphBreak
+			isFirstWord = true
+			curLineSb.Reset()
+			lineStarted = false
+		case Word:
+			if !haveSeg {
+				segStartOffset = tok.Offset
+			}
+			segSb.WriteString(tok.Text)
+			segEndOffset = tok.Offset + tok.Length
+			for _, r := range tok.Text {
+				segWidth += fc.getRunePixelWidth(r, fontID)
+			}
+			haveSeg = true
+		case ControlCode:
+			if !haveSeg {
+				segStartOffset = tok.Offset
+			}
+			segSb.WriteString(tok.Text)
+			segEndOffset = tok.Offset + tok.Length
+			width, _ := fc.getControlCodePixelWidth(tok.Text, fontID, FormatModeActual)
+			segWidth += width
+			if !fc.isKnownControlCode(tok.Text, fontID) {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("unknown control code '%s'", tok.Text),
+					Offset:   tok.Offset,
+					Length:   tok.Length,
+				})
+			}
+			haveSeg = true
+		}
+	}
+	flushSeg()
+	checkLineLength()
+
+	if curLineSb.Len() > 0 {
+		formattedSb.WriteString(curLineSb.String())
+	}
+
+	return formattedSb.String(), diags, nil
+}
+
+// isKnownControlCode reports whether code is recognized, either because the
+// font has an explicit width for it, it names a declared substitution, or
+// it is listed in KnownControlCodes.
+func (fc *FontConfig) isKnownControlCode(code string, fontID string) bool {
+	if font, ok := fc.Fonts[fontID]; ok {
+		if _, ok := font.Widths[code]; ok {
+			return true
+		}
+	}
+	name := controlCodeName(code)
+	if _, ok := fc.Substitutions[name]; ok {
+		return true
+	}
+	return fc.KnownControlCodes[name]
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func hasSeverity(diags []Diagnostic, sev Severity, substr string) bool {
+	for _, d := range diags {
+		if d.Severity == sev && strings.Contains(d.Message, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFormatTextDiagUnknownControlCode(t *testing.T) {
+	var fc FontConfig
+
+	_, diags, err := fc.FormatTextDiag("Hi {PLAYER}!", 1000, testFontID)
+	if err != nil {
+		t.Fatalf("FormatTextDiag returned unexpected error: %s", err)
+	}
+	if !hasSeverity(diags, SeverityWarning, "unknown control code '{PLAYER}'") {
+		t.Errorf("diags = %+v, want a warning about unknown control code '{PLAYER}'", diags)
+	}
+
+	fc.KnownControlCodes = map[string]bool{"PLAYER": true}
+	_, diags, err = fc.FormatTextDiag("Hi {PLAYER}!", 1000, testFontID)
+	if err != nil {
+		t.Fatalf("FormatTextDiag returned unexpected error: %s", err)
+	}
+	if hasSeverity(diags, SeverityWarning, "unknown control code") {
+		t.Errorf("diags = %+v, want no unknown control code warning once {PLAYER} is declared known", diags)
+	}
+}
+
+func TestFormatTextDiagSingleWordOverflow(t *testing.T) {
+	var fc FontConfig
+
+	_, diags, err := fc.FormatTextDiag("HELLO world", 20, testFontID)
+	if err != nil {
+		t.Fatalf("FormatTextDiag returned unexpected error: %s", err)
+	}
+	if !hasSeverity(diags, SeverityWarning, "overflows the max line width") {
+		t.Errorf("diags = %+v, want a warning about a word overflowing maxWidth", diags)
+	}
+}
+
+func TestFormatTextDiagUnmatchedBraces(t *testing.T) {
+	var fc FontConfig
+
+	_, diags, err := fc.FormatTextDiag("Hello {PLAYER world", 50, testFontID)
+	if err != nil {
+		t.Fatalf("FormatTextDiag returned unexpected error: %s", err)
+	}
+	if !hasSeverity(diags, SeverityError, "unmatched '{'") {
+		t.Errorf("diags = %+v, want an error about the unmatched '{'", diags)
+	}
+	if hasSeverity(diags, SeverityWarning, "'{PLAYER'") {
+		t.Errorf("diags = %+v, recovery should not fabricate a merged '{PLAYER' word", diags)
+	}
+
+	_, diags, err = fc.FormatTextDiag("Hello PLAYER} world", 50, testFontID)
+	if err != nil {
+		t.Fatalf("FormatTextDiag returned unexpected error: %s", err)
+	}
+	if !hasSeverity(diags, SeverityError, "unmatched '}'") {
+		t.Errorf("diags = %+v, want an error about the unmatched '}'", diags)
+	}
+	if hasSeverity(diags, SeverityWarning, "'PLAYER}'") {
+		t.Errorf("diags = %+v, recovery should not fabricate a merged 'PLAYER}' word", diags)
+	}
+}
+
+func TestFormatTextDiagLineTooLong(t *testing.T) {
+	fc := FontConfig{
+		Fonts: map[string]Fonts{
+			testFontID: {MaxLineLength: 5},
+		},
+	}
+
+	_, diags, err := fc.FormatTextDiag("Hello World", 100000, testFontID)
+	if err != nil {
+		t.Fatalf("FormatTextDiag returned unexpected error: %s", err)
+	}
+	if !hasSeverity(diags, SeverityWarning, "exceeds the configured max") {
+		t.Errorf("diags = %+v, want a warning about the line exceeding MaxLineLength", diags)
+	}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// RoundMode controls how a glyph's fractional advance width is rounded to a
+// whole pixel count.
+type RoundMode int
+
+const (
+	// RoundNearest rounds to the closest whole pixel.
+	RoundNearest RoundMode = iota
+	// RoundUp always rounds fractional advances up, so text never overflows
+	// a bitmap font's glyph cells.
+	RoundUp
+	// RoundDown always rounds fractional advances down.
+	RoundDown
+)
+
+// ImportOptions configures how ImportFontFromTTF rasterizes and measures a
+// TrueType/OpenType font.
+type ImportOptions struct {
+	// PixelSize is the em size, in pixels, to rasterize glyphs at.
+	PixelSize float64
+	// Charset lists every codepoint to measure and include in the result.
+	Charset []rune
+	// Round selects how fractional advance widths are rounded to whole pixels.
+	Round RoundMode
+	// LetterSpacing is added to every measured glyph's advance width.
+	LetterSpacing int
+}
+
+// ImportFontFromTTF loads a TrueType/OpenType font file, rasterizes each
+// codepoint in opts.Charset at opts.PixelSize, and measures its advance
+// width in whole pixels. The font's missing-glyph (.notdef) is measured the
+// same way and stored as the "default" width, matching the fallback that
+// readWidthFromFontConfig already uses. The result can be merged directly
+// into a FontConfig's Fonts map.
+func ImportFontFromTTF(path string, opts ImportOptions) (Fonts, error) {
+	var fonts Fonts
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fonts, err
+	}
+
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return fonts, fmt.Errorf("failed to parse font '%s': %s", path, err)
+	}
+
+	var buf sfnt.Buffer
+	ppem := fixed.Int26_6(opts.PixelSize * 64)
+
+	measureGlyph := func(index sfnt.GlyphIndex) (int, error) {
+		advance, err := parsed.GlyphAdvance(&buf, index, ppem, font.HintingNone)
+		if err != nil {
+			return 0, err
+		}
+		return roundAdvance(advance, opts.Round) + opts.LetterSpacing, nil
+	}
+
+	widths := make(map[string]int, len(opts.Charset)+1)
+	for _, r := range opts.Charset {
+		index, err := parsed.GlyphIndex(&buf, r)
+		if err != nil {
+			return fonts, fmt.Errorf("failed to look up glyph for %q: %s", r, err)
+		}
+		if index == 0 {
+			// No glyph for this codepoint; leave it unset so the "default"
+			// width is used for it at runtime.
+			continue
+		}
+		width, err := measureGlyph(index)
+		if err != nil {
+			return fonts, fmt.Errorf("failed to measure glyph for %q: %s", r, err)
+		}
+		widths[string(r)] = width
+	}
+
+	defaultWidth, err := measureGlyph(0)
+	if err != nil {
+		return fonts, fmt.Errorf("failed to measure missing-glyph width: %s", err)
+	}
+	widths["default"] = defaultWidth
+
+	fonts.Widths = widths
+	return fonts, nil
+}
+
+// MergeFonts merges newly imported glyph widths into an existing Fonts
+// entry. Widths measured in imported take precedence for the codepoints it
+// covers, but any codepoint only present in existing (for example a
+// hand-authored width outside the imported charset) is carried forward.
+// existing's MaxLineLength is kept as-is, since ImportFontFromTTF has no
+// opinion on it.
+func MergeFonts(existing, imported Fonts) Fonts {
+	widths := make(map[string]int, len(existing.Widths)+len(imported.Widths))
+	for codepoint, width := range existing.Widths {
+		widths[codepoint] = width
+	}
+	for codepoint, width := range imported.Widths {
+		widths[codepoint] = width
+	}
+	return Fonts{
+		Widths:        widths,
+		MaxLineLength: existing.MaxLineLength,
+	}
+}
+
+func roundAdvance(advance fixed.Int26_6, mode RoundMode) int {
+	pixels := float64(advance) / 64
+	switch mode {
+	case RoundUp:
+		return int(math.Ceil(pixels))
+	case RoundDown:
+		return int(math.Floor(pixels))
+	default:
+		return int(math.Round(pixels))
+	}
+}
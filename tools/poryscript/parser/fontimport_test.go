@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/math/fixed"
+)
+
+func TestMergeFonts(t *testing.T) {
+	existing := Fonts{
+		Widths:        map[string]int{"A": 4, "default": 3},
+		MaxLineLength: 160,
+	}
+	imported := Fonts{
+		Widths: map[string]int{"A": 5, "B": 6, "default": 3},
+	}
+
+	got := MergeFonts(existing, imported)
+
+	want := map[string]int{"A": 5, "B": 6, "default": 3}
+	if !reflect.DeepEqual(got.Widths, want) {
+		t.Errorf("MergeFonts(...).Widths = %+v, want %+v", got.Widths, want)
+	}
+	if got.MaxLineLength != existing.MaxLineLength {
+		t.Errorf("MergeFonts(...).MaxLineLength = %d, want %d (existing's, unchanged)", got.MaxLineLength, existing.MaxLineLength)
+	}
+
+	// existing.Widths must not be mutated by the merge.
+	if existing.Widths["B"] != 0 {
+		t.Errorf("MergeFonts mutated existing.Widths: %+v", existing.Widths)
+	}
+}
+
+func TestRoundAdvance(t *testing.T) {
+	// 6.25px, as a fixed.Int26_6 (1/64 pixel units).
+	advance := fixed.Int26_6(6.25 * 64)
+
+	tests := []struct {
+		mode RoundMode
+		want int
+	}{
+		{RoundNearest, 6},
+		{RoundUp, 7},
+		{RoundDown, 6},
+	}
+
+	for _, tt := range tests {
+		if got := roundAdvance(advance, tt.mode); got != tt.want {
+			t.Errorf("roundAdvance(6.25px, %v) = %d, want %d", tt.mode, got, tt.want)
+		}
+	}
+}
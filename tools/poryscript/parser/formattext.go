@@ -4,15 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"regexp"
 	"strings"
 )
 
 // FontConfig holds the configuration for various supported fonts, as well as
 // the default font.
 type FontConfig struct {
-	DefaultFontID string           `json:"defaultFontId"`
-	Fonts         map[string]Fonts `json:"fonts"`
+	DefaultFontID string                      `json:"defaultFontId"`
+	Fonts         map[string]Fonts            `json:"fonts"`
+	Substitutions map[string]SubstitutionSpec `json:"substitutions"`
+	// KnownControlCodes optionally lists control code names (without braces)
+	// that are valid even though they have no configured width, such as
+	// codes that only affect rendering (e.g. color) rather than layout.
+	// FormatTextDiag consults this, in addition to Fonts[fontID].Widths and
+	// Substitutions, before reporting a control code as unknown.
+	KnownControlCodes map[string]bool `json:"knownControlCodes"`
 }
 
 type Fonts struct {
@@ -20,6 +26,18 @@ type Fonts struct {
 	MaxLineLength int            `json:"maxLineLength"`
 }
 
+// SubstitutionSpec declares the assumed width of a control code (such as
+// `{PLAYER}`) that expands to a variable-length, runtime-determined string.
+// Width is a single fixed assumption; Sample measures the width of an
+// example expansion (e.g. the longest in-game name); MaxWidth bounds the
+// largest the substitution could ever expand to, so callers can format
+// for the worst case (FormatModeWorstCase).
+type SubstitutionSpec struct {
+	Width    *int   `json:"width,omitempty"`
+	Sample   string `json:"sample,omitempty"`
+	MaxWidth *int   `json:"maxWidth,omitempty"`
+}
+
 // LoadFontConfig reads a font width config JSON file.
 func LoadFontConfig(filepath string) (FontConfig, error) {
 	var config FontConfig
@@ -35,11 +53,259 @@ func LoadFontConfig(filepath string) (FontConfig, error) {
 	return config, err
 }
 
+// SaveFontConfig writes a font width config out as JSON.
+func SaveFontConfig(filepath string, config FontConfig) error {
+	bytes, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath, bytes, 0644)
+}
+
 const testFontID = "TEST"
 
+// TokenType identifies the kind of text that a Token represents.
+type TokenType int
+
+const (
+	// Word is a run of regular display characters with no surrounding whitespace.
+	Word TokenType = iota
+	// Space is a run of one or more whitespace characters, collapsed to a single space.
+	Space
+	// ControlCode is an atomic `{...}` sequence, including its braces.
+	ControlCode
+	// LineBreak is the `\n` directive.
+	LineBreak
+	// ParagraphBreak is the `\p` directive.
+	ParagraphBreak
+	// ScrollBreak is the `\l` directive.
+	ScrollBreak
+)
+
+// Token is a single lexical unit produced by TokenizeText. Offset and Length
+// are byte positions into the original input string, so that callers (e.g.
+// FormatTextDiag) can report diagnostics against the source text.
+type Token struct {
+	Type   TokenType
+	Text   string
+	Offset int
+	Length int
+}
+
+// TokenizeText scans text into a stream of Tokens, so that callers can
+// reason about words, control codes, and line directives without
+// re-scanning the raw string themselves. A `{...}` sequence is always
+// emitted as a single atomic ControlCode token, even if it contains nested
+// braces or internal whitespace. `\{` and `\}` are treated as literal
+// escaped braces rather than control code delimiters.
+//
+// fontID is accepted alongside text for parity with the rest of this
+// package's text APIs; tokenization itself does not depend on font data.
+func TokenizeText(text, fontID string) ([]Token, error) {
+	tokens, diags := tokenizeText(text)
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return nil, fmt.Errorf(d.Message)
+		}
+	}
+	return tokens, nil
+}
+
+// tokenizeText is the tolerant core of TokenizeText: rather than aborting on
+// a malformed `{...}` sequence, it records a Diagnostic and recovers by
+// treating the offending `{` as a literal character, so that callers like
+// FormatTextDiag can keep producing output and reporting every problem in
+// one pass.
+func tokenizeText(text string) ([]Token, []Diagnostic) {
+	runes := []rune(text)
+	n := len(runes)
+	var tokens []Token
+	var diags []Diagnostic
+	i := 0
+	for i < n {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < n && isBreakRune(runes[i+1]):
+			tokens = append(tokens, breakToken(runes, i))
+			i += 2
+		case isSpaceRune(r):
+			start := i
+			i++
+			for i < n && isSpaceRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Type: Space, Text: " ", Offset: byteOffset(runes, start), Length: byteOffset(runes, i) - byteOffset(runes, start)})
+		case r == '{':
+			code, next, err := scanControlCode(runes, i)
+			if err != nil {
+				diags = append(diags, Diagnostic{
+					Severity: SeverityError,
+					Message:  err.Error(),
+					Offset:   byteOffset(runes, i),
+					Length:   byteOffset(runes, i+1) - byteOffset(runes, i),
+				})
+				tokens = append(tokens, unmatchedBraceTokens(runes, i, "{")...)
+				i++
+				continue
+			}
+			tokens = append(tokens, Token{Type: ControlCode, Text: code, Offset: byteOffset(runes, i), Length: byteOffset(runes, next) - byteOffset(runes, i)})
+			i = next
+		case r == '}':
+			diags = append(diags, Diagnostic{
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("unmatched '}' in text at position %d", i),
+				Offset:   byteOffset(runes, i),
+				Length:   byteOffset(runes, i+1) - byteOffset(runes, i),
+			})
+			tokens = append(tokens, unmatchedBraceTokens(runes, i, "}")...)
+			i++
+		default:
+			start := i
+			for i < n {
+				if isSpaceRune(runes[i]) || runes[i] == '{' || runes[i] == '}' {
+					break
+				}
+				if runes[i] == '\\' {
+					if i+1 < n && isBreakRune(runes[i+1]) {
+						break
+					}
+					if i+1 < n && (runes[i+1] == '{' || runes[i+1] == '}') {
+						i += 2
+						continue
+					}
+				}
+				i++
+			}
+			tokens = append(tokens, Token{
+				Type:   Word,
+				Text:   unescapeBraces(string(runes[start:i])),
+				Offset: byteOffset(runes, start),
+				Length: byteOffset(runes, i) - byteOffset(runes, start),
+			})
+		}
+	}
+	return tokens, diags
+}
+
+// byteOffset converts a rune index within runes into a byte offset in the
+// original UTF-8 string they were decoded from.
+func byteOffset(runes []rune, idx int) int {
+	return len(string(runes[:idx]))
+}
+
+func isSpaceRune(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
+}
+
+func isBreakRune(r rune) bool {
+	return r == 'n' || r == 'l' || r == 'p'
+}
+
+func breakToken(runes []rune, i int) Token {
+	offset := byteOffset(runes, i)
+	length := byteOffset(runes, i+2) - offset
+	switch runes[i+1] {
+	case 'n':
+		return Token{Type: LineBreak, Text: `\n`, Offset: offset, Length: length}
+	case 'l':
+		return Token{Type: ScrollBreak, Text: `\l`, Offset: offset, Length: length}
+	default:
+		return Token{Type: ParagraphBreak, Text: `\p`, Offset: offset, Length: length}
+	}
+}
+
+// unmatchedBraceTokens wraps a stray, unmatched brace recovered at rune
+// index i in its own zero-width Space boundaries, so that it is emitted as
+// an isolated Word token instead of silently fusing with the words on
+// either side of it into a word that never existed in the input.
+func unmatchedBraceTokens(runes []rune, i int, brace string) []Token {
+	offset := byteOffset(runes, i)
+	length := byteOffset(runes, i+1) - offset
+	boundary := Token{Type: Space, Offset: offset, Length: 0}
+	return []Token{boundary, {Type: Word, Text: brace, Offset: offset, Length: length}, boundary}
+}
+
+// scanControlCode reads a `{...}` sequence starting at the opening brace
+// runes[start], tracking nesting depth and skipping escaped braces, and
+// returns the full atomic code text (including its braces) along with the
+// position just past the closing brace.
+func scanControlCode(runes []rune, start int) (string, int, error) {
+	n := len(runes)
+	i := start + 1
+	depth := 1
+	for i < n {
+		switch {
+		case runes[i] == '\\' && i+1 < n && (runes[i+1] == '{' || runes[i+1] == '}'):
+			i += 2
+		case runes[i] == '{':
+			depth++
+			i++
+		case runes[i] == '}':
+			depth--
+			i++
+			if depth == 0 {
+				return unescapeBraces(string(runes[start:i])), i, nil
+			}
+		default:
+			i++
+		}
+	}
+	return "", i, fmt.Errorf("unmatched '{' in text at position %d", start)
+}
+
+func unescapeBraces(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	runes := []rune(s)
+	var sb strings.Builder
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '{' || runes[i+1] == '}') {
+			sb.WriteRune(runes[i+1])
+			i++
+		} else {
+			sb.WriteRune(runes[i])
+		}
+	}
+	return sb.String()
+}
+
+// FormatMode selects how control codes that expand into runtime-length
+// strings are measured when deciding where to wrap lines.
+type FormatMode int
+
+const (
+	// FormatModeActual uses each control code's configured fixed width. This
+	// is the same behavior as the original FormatText.
+	FormatModeActual FormatMode = iota
+	// FormatModeWorstCase uses a substitution's MaxWidth, the largest width
+	// it could ever expand to, so the wrapped text never overflows at
+	// runtime. A substitution without MaxWidth is measured by its Width or
+	// Sample instead, without a warning, and carries no such guarantee.
+	FormatModeWorstCase
+	// FormatModeSample uses a substitution's representative sample string,
+	// useful for previewing typical-case wrapping. A substitution without
+	// Sample is measured by its Width or MaxWidth instead.
+	FormatModeSample
+)
+
+// FormatOptions configures FormatTextWithOptions.
+type FormatOptions struct {
+	Mode FormatMode
+}
+
 // FormatText automatically inserts line breaks into text
 // according to in-game text box widths.
 func (fc *FontConfig) FormatText(text string, maxWidth int, fontID string) (string, error) {
+	formatted, _, err := fc.FormatTextWithOptions(text, maxWidth, fontID, FormatOptions{})
+	return formatted, err
+}
+
+// FormatTextWithOptions is like FormatText, but lets the caller select how
+// runtime-expanding control codes (see SubstitutionSpec) are measured for
+// line-wrapping decisions. It additionally returns warnings about any
+// substitution that has no usable width for the chosen mode.
+func (fc *FontConfig) FormatTextWithOptions(text string, maxWidth int, fontID string, opts FormatOptions) (string, []string, error) {
 	if !fc.isFontIDValid(fontID) && len(fontID) > 0 && fontID != testFontID {
 		validFontIDs := make([]string, len(fc.Fonts))
 		i := 0
@@ -47,167 +313,166 @@ func (fc *FontConfig) FormatText(text string, maxWidth int, fontID string) (stri
 			validFontIDs[i] = k
 			i++
 		}
-		return "", fmt.Errorf("unknown fontID '%s' used in format(). List of valid fontIDs are '%s'", fontID, validFontIDs)
+		return "", nil, fmt.Errorf("unknown fontID '%s' used in format(). List of valid fontIDs are '%s'", fontID, validFontIDs)
 	}
 
-	text = strings.ReplaceAll(text, "\n", " ")
+	tokens, err := TokenizeText(text, fontID)
+	if err != nil {
+		return "", nil, err
+	}
 
+	var warnings []string
 	var formattedSb strings.Builder
 	var curLineSb strings.Builder
 	curWidth := 0
 	isFirstLine := true
 	isFirstWord := true
-	pos := 0
-	for pos < len(text) {
-		endPos, word, err := fc.getNextWord(text[pos:])
-		if err != nil {
-			return "", err
-		}
-		if len(word) == 0 {
-			break
-		}
-		pos += endPos
-		if fc.isLineBreak(word) {
-			curWidth = 0
+
+	var segSb strings.Builder
+	segWidth := 0
+	haveSeg := false
+
+	appendWord := func(word string, width int) {
+		if curWidth+width > maxWidth && curLineSb.Len() > 0 {
 			formattedSb.WriteString(curLineSb.String())
-			formattedSb.WriteString(word)
-			formattedSb.WriteByte('\n')
-			if fc.isParagraphBreak(word) {
-				isFirstLine = true
-			} else {
+			if isFirstLine {
+				formattedSb.WriteString(`\n`)
 				isFirstLine = false
+			} else {
+				formattedSb.WriteString(`\l`)
 			}
-			isFirstWord = true
+			formattedSb.WriteByte('\n')
 			curLineSb.Reset()
+			curLineSb.WriteString(word)
+			curWidth = width
 		} else {
-			wordWidth := 0
+			curWidth += width
 			if !isFirstWord {
-				wordWidth += fc.getRunePixelWidth(' ', fontID)
-			}
-			wordWidth += fc.getWordPixelWidth(word, fontID)
-			if curWidth+wordWidth > maxWidth && curLineSb.Len() > 0 {
-				formattedSb.WriteString(curLineSb.String())
-				if isFirstLine {
-					formattedSb.WriteString(`\n`)
-					isFirstLine = false
-				} else {
-					formattedSb.WriteString(`\l`)
-				}
-				formattedSb.WriteByte('\n')
-				isFirstWord = false
-				curLineSb.Reset()
-				curLineSb.WriteString(word)
-				curWidth = wordWidth
-			} else {
-				curWidth += wordWidth
-				if !isFirstWord {
-					curLineSb.WriteByte(' ')
-				}
-				curLineSb.WriteString(word)
-				isFirstWord = false
+				curLineSb.WriteByte(' ')
 			}
+			curLineSb.WriteString(word)
 		}
+		isFirstWord = false
 	}
 
-	if curLineSb.Len() > 0 {
-		formattedSb.WriteString(curLineSb.String())
+	flushSeg := func() {
+		if !haveSeg {
+			return
+		}
+		width := segWidth
+		if !isFirstWord {
+			width += fc.getRunePixelWidth(' ', fontID)
+		}
+		appendWord(segSb.String(), width)
+		segSb.Reset()
+		segWidth = 0
+		haveSeg = false
 	}
 
-	return formattedSb.String(), nil
-}
-
-func (fc *FontConfig) getNextWord(text string) (int, string, error) {
-	escape := false
-	endPos := 0
-	startPos := 0
-	foundNonSpace := false
-	foundRegularRune := false
-	endOnNext := false
-	controlCodeLevel := 0
-	for pos, char := range text {
-		if endOnNext {
-			return pos, text[startPos:pos], nil
-		}
-		if escape && (char == 'l' || char == 'n' || char == 'p') {
-			if foundRegularRune {
-				return endPos, text[startPos:endPos], nil
+	for _, tok := range tokens {
+		switch tok.Type {
+		case Space:
+			flushSeg()
+		case LineBreak, ScrollBreak, ParagraphBreak:
+			flushSeg()
+			curWidth = 0
+			formattedSb.WriteString(curLineSb.String())
+			formattedSb.WriteString(tok.Text)
+			formattedSb.WriteByte('\n')
+			isFirstLine = tok.Type == ParagraphBreak
+			isFirstWord = true
+			curLineSb.Reset()
+		case Word:
+			segSb.WriteString(tok.Text)
+			for _, r := range tok.Text {
+				segWidth += fc.getRunePixelWidth(r, fontID)
 			}
-			endOnNext = true
-		} else if char == '\\' && controlCodeLevel == 0 {
-			escape = true
-			if !foundRegularRune {
-				startPos = pos
+			haveSeg = true
+		case ControlCode:
+			segSb.WriteString(tok.Text)
+			width, warning := fc.getControlCodePixelWidth(tok.Text, fontID, opts.Mode)
+			if warning != "" {
+				warnings = append(warnings, warning)
 			}
-			foundNonSpace = true
-			endPos = pos
-		} else {
-			if char == ' ' {
-				if foundNonSpace && controlCodeLevel == 0 {
-					return pos, text[startPos:pos], nil
-				}
-			} else {
-				if !foundNonSpace {
-					startPos = pos
-				}
-				foundRegularRune = true
-				foundNonSpace = true
-				if char == '{' {
-					controlCodeLevel++
-				} else if char == '}' {
-					if controlCodeLevel > 0 {
-						controlCodeLevel--
-					}
-				}
-			}
-			escape = false
+			segWidth += width
+			haveSeg = true
 		}
 	}
-	if !foundNonSpace {
-		return len(text), "", nil
+	flushSeg()
+
+	if curLineSb.Len() > 0 {
+		formattedSb.WriteString(curLineSb.String())
 	}
-	return len(text), text[startPos:], nil
+
+	return formattedSb.String(), warnings, nil
 }
 
-func (fc *FontConfig) isLineBreak(word string) bool {
-	return word == `\n` || word == `\l` || word == `\p`
+func (fc *FontConfig) getRunePixelWidth(r rune, fontID string) int {
+	if fontID == testFontID {
+		return 10
+	}
+	return fc.readWidthFromFontConfig(string(r), fontID)
 }
 
-func (fc *FontConfig) isParagraphBreak(word string) bool {
-	return word == `\p`
+// getControlCodePixelWidth resolves the pixel width of a control code for
+// the given FormatMode. Codes with a matching SubstitutionSpec are measured
+// according to mode; everything else falls back to the font's configured
+// per-code width, as before. It returns a non-empty warning when a
+// substitution has no usable width for the requested mode.
+func (fc *FontConfig) getControlCodePixelWidth(code string, fontID string, mode FormatMode) (int, string) {
+	if fontID == testFontID {
+		return 100, ""
+	}
+	if spec, ok := fc.Substitutions[controlCodeName(code)]; ok {
+		return fc.resolveSubstitutionWidth(code, spec, fontID, mode)
+	}
+	return fc.readWidthFromFontConfig(code, fontID), ""
 }
 
-func (fc *FontConfig) getWordPixelWidth(word string, fontID string) int {
-	word, wordWidth := fc.processControlCodes(word, fontID)
-	for _, r := range word {
-		wordWidth += fc.getRunePixelWidth(r, fontID)
+func (fc *FontConfig) resolveSubstitutionWidth(code string, spec SubstitutionSpec, fontID string, mode FormatMode) (int, string) {
+	if mode == FormatModeWorstCase && spec.MaxWidth != nil {
+		return *spec.MaxWidth, ""
+	}
+	if mode == FormatModeSample && spec.Sample != "" {
+		return fc.samplePixelWidth(spec.Sample, fontID), ""
+	}
+	if spec.Width != nil {
+		return *spec.Width, ""
+	}
+	if spec.Sample != "" {
+		return fc.samplePixelWidth(spec.Sample, fontID), ""
+	}
+	if spec.MaxWidth != nil {
+		return *spec.MaxWidth, ""
 	}
-	return wordWidth
+	return fc.readWidthFromFontConfig(code, fontID), fmt.Sprintf(
+		"substitution '%s' has no declared width for %s mode; falling back to '%s' font width",
+		controlCodeName(code), formatModeName(mode), fontID)
 }
 
-func (fc *FontConfig) processControlCodes(word string, fontID string) (string, int) {
+func (fc *FontConfig) samplePixelWidth(sample string, fontID string) int {
 	width := 0
-	re := regexp.MustCompile(`{[^}]*}`)
-	positions := re.FindAllStringIndex(word, -1)
-	for _, pos := range positions {
-		code := word[pos[0]:pos[1]]
-		width += fc.getControlCodePixelWidth(code, fontID)
+	for _, r := range sample {
+		width += fc.getRunePixelWidth(r, fontID)
 	}
-	strippedWord := re.ReplaceAllString(word, "")
-	return strippedWord, width
+	return width
 }
 
-func (fc *FontConfig) getRunePixelWidth(r rune, fontID string) int {
-	if fontID == testFontID {
-		return 10
-	}
-	return fc.readWidthFromFontConfig(string(r), fontID)
+func controlCodeName(code string) string {
+	trimmed := strings.TrimPrefix(code, "{")
+	trimmed = strings.TrimSuffix(trimmed, "}")
+	return strings.TrimSpace(trimmed)
 }
 
-func (fc *FontConfig) getControlCodePixelWidth(code string, fontID string) int {
-	if fontID == testFontID {
-		return 100
+func formatModeName(mode FormatMode) string {
+	switch mode {
+	case FormatModeWorstCase:
+		return "WorstCase"
+	case FormatModeSample:
+		return "Sample"
+	default:
+		return "Actual"
 	}
-	return fc.readWidthFromFontConfig(code, fontID)
 }
 
 func (fc *FontConfig) isFontIDValid(fontID string) bool {
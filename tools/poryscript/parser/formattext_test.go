@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []Token
+		wantErr bool
+	}{
+		{
+			name: "plain words and single spaces",
+			text: "Hello world",
+			want: []Token{
+				{Type: Word, Text: "Hello"},
+				{Type: Space, Text: " "},
+				{Type: Word, Text: "world"},
+			},
+		},
+		{
+			name: "mixed whitespace collapses to a single space token",
+			text: "Hello \t\n  world",
+			want: []Token{
+				{Type: Word, Text: "Hello"},
+				{Type: Space, Text: " "},
+				{Type: Word, Text: "world"},
+			},
+		},
+		{
+			name: "control code with internal space is atomic",
+			text: "{COLOR BLUE}",
+			want: []Token{
+				{Type: ControlCode, Text: "{COLOR BLUE}"},
+			},
+		},
+		{
+			name: "nested braces stay in a single control code",
+			text: "{COLOR{1}}",
+			want: []Token{
+				{Type: ControlCode, Text: "{COLOR{1}}"},
+			},
+		},
+		{
+			name: "escaped braces are literal characters, not control codes",
+			text: `\{hi\}`,
+			want: []Token{
+				{Type: Word, Text: "{hi}"},
+			},
+		},
+		{
+			name: "escaped brace inside a word adjacent to a real control code",
+			text: `\{PLAYER{STR_VAR_1}`,
+			want: []Token{
+				{Type: Word, Text: "{PLAYER"},
+				{Type: ControlCode, Text: "{STR_VAR_1}"},
+			},
+		},
+		{
+			name: "line directives",
+			text: `Hi\nthere\lfriend\p`,
+			want: []Token{
+				{Type: Word, Text: "Hi"},
+				{Type: LineBreak, Text: `\n`},
+				{Type: Word, Text: "there"},
+				{Type: ScrollBreak, Text: `\l`},
+				{Type: Word, Text: "friend"},
+				{Type: ParagraphBreak, Text: `\p`},
+			},
+		},
+		{
+			name:    "unmatched opening brace is an error",
+			text:    "Hello {PLAYER world",
+			wantErr: true,
+		},
+		{
+			name:    "unmatched closing brace is an error",
+			text:    "Hello PLAYER} world",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TokenizeText(tt.text, testFontID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("TokenizeText(%q) = %v, want error", tt.text, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TokenizeText(%q) returned unexpected error: %s", tt.text, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("TokenizeText(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+			for i, tok := range got {
+				if tok.Type != tt.want[i].Type || tok.Text != tt.want[i].Text {
+					t.Errorf("TokenizeText(%q) token %d = %+v, want %+v", tt.text, i, tok, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	var fc FontConfig
+
+	got, err := fc.FormatText("This is a reasonably long sentence that should wrap", 100, testFontID)
+	if err != nil {
+		t.Fatalf("FormatText returned unexpected error: %s", err)
+	}
+	if !strings.Contains(got, `\n`) {
+		t.Errorf("FormatText(...) = %q, want at least one \\n line break", got)
+	}
+}
+
+func TestResolveSubstitutionWidthModes(t *testing.T) {
+	max := 90
+	fc := FontConfig{
+		Fonts: map[string]Fonts{
+			"custom": {Widths: map[string]int{"default": 5}},
+		},
+	}
+	spec := SubstitutionSpec{MaxWidth: &max}
+
+	width, warning := fc.resolveSubstitutionWidth("{PLAYER}", spec, "custom", FormatModeWorstCase)
+	if warning != "" {
+		t.Errorf("resolveSubstitutionWidth(mode=WorstCase) warning = %q, want none", warning)
+	}
+	if width != max {
+		t.Errorf("resolveSubstitutionWidth(mode=WorstCase) = %d, want %d", width, max)
+	}
+}